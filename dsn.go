@@ -6,10 +6,16 @@ package dsn
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"net"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
@@ -18,6 +24,53 @@ var (
 	errInvalidDSNNoSlash         = errors.New("invalid DSN: missing the slash separating the database name")
 )
 
+// validateAddr checks that addr is a syntactically valid endpoint for net:
+// a host:port pair (IPv6 hosts may be bracketed) for any network type other
+// than "unix", which instead expects a non-empty socket path.
+func validateAddr(netType, addr string) error {
+	if netType == "unix" {
+		if len(addr) == 0 {
+			return fmt.Errorf("invalid DSN: empty unix socket path")
+		}
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("invalid DSN: invalid address %q: %w", addr, err)
+	}
+	return nil
+}
+
+var (
+	tlsConfigMu       sync.RWMutex
+	tlsConfigRegistry map[string]*tls.Config
+)
+
+// RegisterTLSConfig registers a custom tls.Config under name, so it can be
+// referenced from a DSN using tls=<name>. name must not be one of the
+// reserved values "true", "false" or "skip-verify".
+func RegisterTLSConfig(name string, cfg *tls.Config) error {
+	switch strings.ToLower(name) {
+	case "true", "false", "skip-verify":
+		return fmt.Errorf("invalid TLS config name: %s", name)
+	}
+
+	tlsConfigMu.Lock()
+	defer tlsConfigMu.Unlock()
+	if tlsConfigRegistry == nil {
+		tlsConfigRegistry = make(map[string]*tls.Config)
+	}
+	tlsConfigRegistry[name] = cfg
+	return nil
+}
+
+// getTLSConfig looks up a tls.Config registered via RegisterTLSConfig.
+func getTLSConfig(name string) (*tls.Config, bool) {
+	tlsConfigMu.RLock()
+	defer tlsConfigMu.RUnlock()
+	cfg, ok := tlsConfigRegistry[name]
+	return cfg, ok
+}
+
 // Config is a configuration parsed from a DSN string.
 // If a new Config is created instead of being parsed from a DSN string,
 // the NewConfig function should be used, which sets default values.
@@ -25,9 +78,28 @@ type DSN struct {
 	User   string            // Username
 	Passwd string            // Password (requires User)
 	Net    string            // Network type
-	Addr   string            // Network address (requires Net)
+	Addr   string            // Network address (requires Net); the first entry of Addrs
+	Addrs  []string          // Failover network addresses (requires Net); Addrs[0] == Addr
 	DBName string            // Database name
 	Params map[string]string // Connection parameters
+
+	TLS       string         // TLS configuration: "true", "false", "skip-verify", or a name registered with RegisterTLSConfig
+	Collation string         // Connection collation
+	Loc       *time.Location // Location for time.Time values
+
+	Timeout      time.Duration // Dial timeout
+	ReadTimeout  time.Duration // I/O read timeout
+	WriteTimeout time.Duration // I/O write timeout
+
+	MaxAllowedPacket *int // Max packet size allowed; nil if not explicitly set
+
+	// These are pointers, not plain bool/int, so that an explicit false/zero
+	// parsed from a DSN (e.g. "parseTime=false") is distinguishable from the
+	// option simply never having been set, and survives being reformatted.
+	ParseTime            *bool // Parse time values to time.Time
+	AllowNativePasswords *bool // Allow the mysql_native_password auth method
+	InterpolateParams    *bool // Interpolate placeholders into query string
+	MultiStatements      *bool // Allow multiple statements in one query
 }
 
 // FormatDSN formats the given Config into a DSN string which can be passed to
@@ -48,7 +120,11 @@ func (cfg *DSN) FormatDSN() string {
 	// [protocol[(address)]]
 	if len(cfg.Net) > 0 {
 		buf.WriteString(cfg.Net)
-		if len(cfg.Addr) > 0 {
+		if len(cfg.Addrs) > 1 {
+			buf.WriteByte('(')
+			buf.WriteString(strings.Join(cfg.Addrs, ","))
+			buf.WriteByte(')')
+		} else if len(cfg.Addr) > 0 {
 			buf.WriteByte('(')
 			buf.WriteString(cfg.Addr)
 			buf.WriteByte(')')
@@ -57,44 +133,171 @@ func (cfg *DSN) FormatDSN() string {
 
 	// /dbname
 	buf.WriteByte('/')
-	buf.WriteString(cfg.DBName)
+	buf.WriteString(url.QueryEscape(cfg.DBName))
 
 	// [?param1=value1&...&paramN=valueN]
-	hasParam := false
+	if q := cfg.formatQuery(); len(q) > 0 {
+		buf.WriteByte('?')
+		buf.WriteString(q)
+	}
+
+	return buf.String()
+}
+
+// FormatURL formats the given Config into a mysql:// DSN URL.
+func (cfg *DSN) FormatURL() string {
+	var buf bytes.Buffer
 
-	// other params
-	if cfg.Params != nil {
-		var params []string
-		for param := range cfg.Params {
-			params = append(params, param)
+	buf.WriteString("mysql://")
+
+	// [username[:password]@]
+	// PathEscape, not QueryEscape: the user/password/dbname land in the URL's
+	// userinfo and path components, which net/url decodes without turning a
+	// literal '+' into a space the way query-string decoding does.
+	if len(cfg.User) > 0 {
+		buf.WriteString(url.PathEscape(cfg.User))
+		if len(cfg.Passwd) > 0 {
+			buf.WriteByte(':')
+			buf.WriteString(url.PathEscape(cfg.Passwd))
 		}
-		sort.Strings(params)
-		for _, param := range params {
-			if hasParam {
-				buf.WriteByte('&')
-			} else {
-				hasParam = true
-				buf.WriteByte('?')
-			}
-
-			buf.WriteString(param)
-			buf.WriteByte('=')
-			buf.WriteString(url.QueryEscape(cfg.Params[param]))
+		buf.WriteByte('@')
+	}
+
+	// host[:port][,host[:port]...]
+	if len(cfg.Addrs) > 1 {
+		buf.WriteString(strings.Join(cfg.Addrs, ","))
+	} else {
+		buf.WriteString(cfg.Addr)
+	}
+
+	// /dbname
+	buf.WriteByte('/')
+	buf.WriteString(url.PathEscape(cfg.DBName))
+
+	// [?param1=value1&...&paramN=valueN]
+	if q := cfg.formatQuery(); len(q) > 0 {
+		buf.WriteByte('?')
+		buf.WriteString(q)
+	}
+
+	return buf.String()
+}
+
+// formatQuery builds the canonical, sorted query-string portion of a DSN
+// (without the leading '?'), merging Params with the typed options.
+func (cfg *DSN) formatQuery() string {
+	params := make(map[string]string, len(cfg.Params))
+	for k, v := range cfg.Params {
+		params[k] = v
+	}
+
+	// typed options
+	if len(cfg.TLS) > 0 {
+		params["tls"] = cfg.TLS
+	}
+	if len(cfg.Collation) > 0 {
+		params["collation"] = cfg.Collation
+	}
+	if cfg.Loc != nil {
+		params["loc"] = cfg.Loc.String()
+	}
+	if cfg.Timeout > 0 {
+		params["timeout"] = cfg.Timeout.String()
+	}
+	if cfg.ReadTimeout > 0 {
+		params["readTimeout"] = cfg.ReadTimeout.String()
+	}
+	if cfg.WriteTimeout > 0 {
+		params["writeTimeout"] = cfg.WriteTimeout.String()
+	}
+	if cfg.MaxAllowedPacket != nil {
+		params["maxAllowedPacket"] = strconv.Itoa(*cfg.MaxAllowedPacket)
+	}
+	if cfg.ParseTime != nil {
+		params["parseTime"] = strconv.FormatBool(*cfg.ParseTime)
+	}
+	if cfg.AllowNativePasswords != nil {
+		params["allowNativePasswords"] = strconv.FormatBool(*cfg.AllowNativePasswords)
+	}
+	if cfg.InterpolateParams != nil {
+		params["interpolateParams"] = strconv.FormatBool(*cfg.InterpolateParams)
+	}
+	if cfg.MultiStatements != nil {
+		params["multiStatements"] = strconv.FormatBool(*cfg.MultiStatements)
+	}
+
+	var keys []string
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte('&')
 		}
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(url.QueryEscape(params[k]))
 	}
 
 	return buf.String()
 }
 
+// NewDSN creates a new Config and populates it with sensible default values.
+// ParseDSN and ParseURL deliberately do not apply these defaults: a parsed
+// Config reflects only what was actually present in the source string, so
+// reformatting it doesn't fabricate options nobody asked for.
 func NewDSN() *DSN {
-	dsn := new(DSN)
+	maxAllowedPacket := 4 << 20 // 4MiB
+	allowNativePasswords := true
+	dsn := &DSN{
+		Collation:            "utf8mb4_general_ci",
+		Loc:                  time.UTC,
+		MaxAllowedPacket:     &maxAllowedPacket,
+		AllowNativePasswords: &allowNativePasswords,
+	}
 	return dsn
 }
 
-// ParseDSN parses the DSN string to a Config
+// hasSlashOutsideParens reports whether dsn contains a '/' that sits outside
+// of any parenthesized address group. A '/' inside the parens (e.g. a unix
+// socket path such as "unix(/tmp/mysql.sock)") doesn't indicate a dbname
+// section; a '/' anywhere else does.
+func hasSlashOutsideParens(dsn string) bool {
+	depth := 0
+	for _, r := range dsn {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case '/':
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseDSN parses the DSN string to a Config. It is tolerant of a couple of
+// shorthand forms: a bare "localhost" is treated the same as an empty DSN,
+// and a trailing "/" after "net(addr)" may be omitted when the DSN carries
+// no dbname/params section at all (i.e. it has no '/' outside of the
+// parenthesized address).
 func ParseDSN(dsn string) (cfg *DSN, err error) {
-	// New config with some default values
-	cfg = NewDSN()
+	if dsn == "localhost" {
+		dsn = ""
+	}
+	if strings.HasSuffix(dsn, ")") && !hasSlashOutsideParens(dsn) {
+		dsn += "/"
+	}
+
+	cfg = &DSN{}
 
 	// [user[:password]@][net[(addr)]]/dbname[?param1=value1&paramN=valueN]
 	// Find the last '/' (since the password or the net addr might contain a '/')
@@ -140,6 +343,16 @@ func ParseDSN(dsn string) (cfg *DSN, err error) {
 					}
 				}
 				cfg.Net = dsn[j+1: k]
+
+				if len(cfg.Addr) > 0 {
+					cfg.Addrs = strings.Split(cfg.Addr, ",")
+					cfg.Addr = cfg.Addrs[0]
+					for _, addr := range cfg.Addrs {
+						if err = validateAddr(cfg.Net, addr); err != nil {
+							return nil, err
+						}
+					}
+				}
 			}
 
 			// dbname[?param1=value1&...&paramN=valueN]
@@ -152,7 +365,9 @@ func ParseDSN(dsn string) (cfg *DSN, err error) {
 					break
 				}
 			}
-			cfg.DBName = dsn[i+1: j]
+			if cfg.DBName, err = url.QueryUnescape(dsn[i+1 : j]); err != nil {
+				return nil, fmt.Errorf("invalid dbname '%s': %w", dsn[i+1:j], err)
+			}
 
 			break
 		}
@@ -163,6 +378,48 @@ func ParseDSN(dsn string) (cfg *DSN, err error) {
 	return
 }
 
+// ParseURL parses a URL-style DSN, as accepted by many MySQL clients, e.g.
+// "mysql://user:pw@host:3306/db?tls=true". The "mysql" and "mariadb" schemes
+// are both accepted. The network is always assumed to be "tcp".
+func ParseURL(dsnURL string) (cfg *DSN, err error) {
+	u, err := url.Parse(dsnURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "mysql", "mariadb":
+	default:
+		return nil, fmt.Errorf("invalid DSN URL: unsupported scheme %q", u.Scheme)
+	}
+
+	cfg = &DSN{}
+	cfg.Net = "tcp"
+	cfg.Addr = u.Host
+	if len(cfg.Addr) > 0 {
+		cfg.Addrs = strings.Split(cfg.Addr, ",")
+		cfg.Addr = cfg.Addrs[0]
+		for _, addr := range cfg.Addrs {
+			if err = validateAddr(cfg.Net, addr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if u.User != nil {
+		cfg.User = u.User.Username()
+		cfg.Passwd, _ = u.User.Password()
+	}
+	cfg.DBName = strings.TrimPrefix(u.Path, "/")
+
+	if len(u.RawQuery) > 0 {
+		if err = parseDSNParams(cfg, u.RawQuery); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
 // parseDSNParams parses the DSN "query string"
 // Values must be url.QueryEscape'ed
 func parseDSNParams(cfg *DSN, params string) (err error) {
@@ -171,14 +428,71 @@ func parseDSNParams(cfg *DSN, params string) (err error) {
 		if len(param) != 2 {
 			continue
 		}
-		// lazy init
-		if cfg.Params == nil {
-			cfg.Params = make(map[string]string)
-		}
-		value := param[1]
-		if cfg.Params[param[0]], err = url.QueryUnescape(value); err != nil {
+
+		key := param[0]
+		var value string
+		if value, err = url.QueryUnescape(param[1]); err != nil {
 			return
 		}
+
+		switch key {
+		case "tls":
+			cfg.TLS = value
+		case "collation":
+			cfg.Collation = value
+		case "loc":
+			if cfg.Loc, err = time.LoadLocation(value); err != nil {
+				return fmt.Errorf("invalid loc '%s': %w", value, err)
+			}
+		case "timeout":
+			if cfg.Timeout, err = time.ParseDuration(value); err != nil {
+				return fmt.Errorf("invalid timeout '%s': %w", value, err)
+			}
+		case "readTimeout":
+			if cfg.ReadTimeout, err = time.ParseDuration(value); err != nil {
+				return fmt.Errorf("invalid readTimeout '%s': %w", value, err)
+			}
+		case "writeTimeout":
+			if cfg.WriteTimeout, err = time.ParseDuration(value); err != nil {
+				return fmt.Errorf("invalid writeTimeout '%s': %w", value, err)
+			}
+		case "maxAllowedPacket":
+			var maxAllowedPacket int
+			if maxAllowedPacket, err = strconv.Atoi(value); err != nil {
+				return fmt.Errorf("invalid maxAllowedPacket '%s': %w", value, err)
+			}
+			cfg.MaxAllowedPacket = &maxAllowedPacket
+		case "parseTime":
+			var parseTime bool
+			if parseTime, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("invalid parseTime '%s': %w", value, err)
+			}
+			cfg.ParseTime = &parseTime
+		case "allowNativePasswords":
+			var allowNativePasswords bool
+			if allowNativePasswords, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("invalid allowNativePasswords '%s': %w", value, err)
+			}
+			cfg.AllowNativePasswords = &allowNativePasswords
+		case "interpolateParams":
+			var interpolateParams bool
+			if interpolateParams, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("invalid interpolateParams '%s': %w", value, err)
+			}
+			cfg.InterpolateParams = &interpolateParams
+		case "multiStatements":
+			var multiStatements bool
+			if multiStatements, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("invalid multiStatements '%s': %w", value, err)
+			}
+			cfg.MultiStatements = &multiStatements
+		default:
+			// lazy init
+			if cfg.Params == nil {
+				cfg.Params = make(map[string]string)
+			}
+			cfg.Params[key] = value
+		}
 	}
 	return
 }
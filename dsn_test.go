@@ -5,10 +5,24 @@
 package dsn
 
 import (
+	"crypto/tls"
 	"reflect"
 	"testing"
+	"time"
 )
 
+// withAddrs fills in Addrs from Addr, since ParseDSN and ParseURL always
+// populate both together.
+func withAddrs(cfg DSN) *DSN {
+	if len(cfg.Addr) > 0 && cfg.Addrs == nil {
+		cfg.Addrs = []string{cfg.Addr}
+	}
+	return &cfg
+}
+
+func boolPtr(b bool) *bool { return &b }
+func intPtr(i int) *int    { return &i }
+
 func TestParseDSN(t *testing.T) {
 	type args struct {
 		dsn string
@@ -22,21 +36,66 @@ func TestParseDSN(t *testing.T) {
 		{
 			name: "test1",
 			args: args{"root:123456@tcp(127.0.0.1:3306)/Test?charset=utf8"},
-			wantCfg: &DSN{User: "root", Passwd: "123456", Net: "tcp", Addr: "127.0.0.1:3306", DBName: "Test", Params: map[string]string{
+			wantCfg: withAddrs(DSN{User: "root", Passwd: "123456", Net: "tcp", Addr: "127.0.0.1:3306", DBName: "Test", Params: map[string]string{
 				"charset": "utf8",
-			}},
+			}}),
 		},
 		{
 			name: "test2",
 			args: args{"root:123456@/Test?charset=utf8"},
-			wantCfg: &DSN{User: "root", Passwd: "123456", Net: "", Addr: "", DBName: "Test", Params: map[string]string{
+			wantCfg: withAddrs(DSN{User: "root", Passwd: "123456", Net: "", Addr: "", DBName: "Test", Params: map[string]string{
 				"charset": "utf8",
-			}},
+			}}),
 		},
 		{
 			name:    "test2",
 			args:    args{"root@/Test"},
-			wantCfg: &DSN{User: "root", Passwd: "", Net: "", Addr: "", DBName: "Test", Params: nil},
+			wantCfg: withAddrs(DSN{User: "root", Passwd: "", Net: "", Addr: "", DBName: "Test", Params: nil}),
+		},
+		{
+			name: "escaped slash in dbname",
+			args: args{"root:pw@tcp(127.0.0.1:3306)/my%2Fdb?charset=utf8"},
+			wantCfg: withAddrs(DSN{User: "root", Passwd: "pw", Net: "tcp", Addr: "127.0.0.1:3306", DBName: "my/db", Params: map[string]string{
+				"charset": "utf8",
+			}}),
+		},
+		{
+			name:    "escaped space in dbname",
+			args:    args{"root@/my%20db"},
+			wantCfg: withAddrs(DSN{User: "root", Passwd: "", Net: "", Addr: "", DBName: "my db", Params: nil}),
+		},
+		{
+			name:    "malformed escape in dbname",
+			args:    args{"root@/my%2"},
+			wantCfg: nil,
+			wantErr: true,
+		},
+		{
+			name:    "bare localhost is an empty DSN",
+			args:    args{"localhost"},
+			wantCfg: &DSN{},
+		},
+		{
+			name:    "missing trailing slash after addr",
+			args:    args{"root@tcp(127.0.0.1:3306)"},
+			wantCfg: withAddrs(DSN{User: "root", Net: "tcp", Addr: "127.0.0.1:3306"}),
+		},
+		{
+			name:    "dbname that merely ends in a closing paren is untouched",
+			args:    args{"root@/orders(archive)"},
+			wantCfg: withAddrs(DSN{User: "root", DBName: "orders(archive)"}),
+		},
+		{
+			name: "trailing paren in a param value is not mistaken for an unterminated addr",
+			args: args{"user@tcp(1.2.3.4:3306)/db?comment=test)"},
+			wantCfg: withAddrs(DSN{User: "user", Net: "tcp", Addr: "1.2.3.4:3306", DBName: "db", Params: map[string]string{
+				"comment": "test)",
+			}}),
+		},
+		{
+			name:    "unix socket path with no dbname",
+			args:    args{"root@unix(/tmp/mysql.sock)"},
+			wantCfg: withAddrs(DSN{User: "root", Net: "unix", Addr: "/tmp/mysql.sock"}),
 		},
 	}
 	for _, tt := range tests {
@@ -81,6 +140,17 @@ func TestDSN_FormatDSN(t *testing.T) {
 		},
 		want: "root:123456@tcp(localhost:3306)/Test?charset=utf8",
 	 },
+	 {
+	 	name: "dbname with slash is escaped",
+	 	fields: fields{
+	 		User:   "root",
+			Passwd: "pw",
+			Net:    "tcp",
+			Addr:   "127.0.0.1:3306",
+			DBName: "my/db",
+		},
+		want: "root:pw@tcp(127.0.0.1:3306)/my%2Fdb",
+	 },
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -98,3 +168,258 @@ func TestDSN_FormatDSN(t *testing.T) {
 		})
 	}
 }
+
+func TestNewDSNDefaults(t *testing.T) {
+	cfg := NewDSN()
+	if cfg.Collation != "utf8mb4_general_ci" {
+		t.Errorf("NewDSN() Collation = %v, want utf8mb4_general_ci", cfg.Collation)
+	}
+	if cfg.Loc != time.UTC {
+		t.Errorf("NewDSN() Loc = %v, want UTC", cfg.Loc)
+	}
+	if cfg.MaxAllowedPacket == nil || *cfg.MaxAllowedPacket != 4<<20 {
+		t.Errorf("NewDSN() MaxAllowedPacket = %v, want %v", cfg.MaxAllowedPacket, 4<<20)
+	}
+	if cfg.AllowNativePasswords == nil || !*cfg.AllowNativePasswords {
+		t.Errorf("NewDSN() AllowNativePasswords = %v, want true", cfg.AllowNativePasswords)
+	}
+}
+
+func TestTypedOptionsRoundTrip(t *testing.T) {
+	want := NewDSN()
+	want.User = "root"
+	want.Net = "tcp"
+	want.Addr = "127.0.0.1:3306"
+	want.Addrs = []string{want.Addr}
+	want.DBName = "Test"
+	want.TLS = "skip-verify"
+	want.Timeout = 5 * time.Second
+	want.ReadTimeout = 30 * time.Second
+	want.WriteTimeout = 30 * time.Second
+	want.ParseTime = boolPtr(true)
+	want.InterpolateParams = boolPtr(true)
+	want.MultiStatements = boolPtr(true)
+
+	got, err := ParseDSN(want.FormatDSN())
+	if err != nil {
+		t.Fatalf("ParseDSN() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseDSNInvalidTypedOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+	}{
+		{"bad timeout", "root@/Test?timeout=notaduration"},
+		{"bad maxAllowedPacket", "root@/Test?maxAllowedPacket=notanumber"},
+		{"bad loc", "root@/Test?loc=Not%2FA%2FPlace"},
+		{"bad parseTime", "root@/Test?parseTime=maybe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseDSN(tt.dsn); err == nil {
+				t.Errorf("ParseDSN(%q) error = nil, want error", tt.dsn)
+			}
+		})
+	}
+}
+
+func TestRegisterTLSConfig(t *testing.T) {
+	if err := RegisterTLSConfig("true", &tls.Config{}); err == nil {
+		t.Error("RegisterTLSConfig(\"true\", ...) error = nil, want error for reserved name")
+	}
+	if err := RegisterTLSConfig("custom", &tls.Config{ServerName: "example.com"}); err != nil {
+		t.Fatalf("RegisterTLSConfig() error = %v", err)
+	}
+	cfg, ok := getTLSConfig("custom")
+	if !ok || cfg.ServerName != "example.com" {
+		t.Errorf("getTLSConfig(\"custom\") = %v, %v", cfg, ok)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		dsnURL  string
+		wantCfg *DSN
+		wantErr bool
+	}{
+		{
+			name:   "mysql scheme",
+			dsnURL: "mysql://root:pw@127.0.0.1:3306/Test?tls=true",
+			wantCfg: withAddrs(DSN{User: "root", Passwd: "pw", Net: "tcp", Addr: "127.0.0.1:3306", DBName: "Test",
+				TLS: "true"}),
+		},
+		{
+			name:   "mariadb scheme",
+			dsnURL: "mariadb://root@127.0.0.1:3306/Test",
+			wantCfg: withAddrs(DSN{User: "root", Net: "tcp", Addr: "127.0.0.1:3306", DBName: "Test"}),
+		},
+		{
+			name:    "unsupported scheme",
+			dsnURL:  "postgres://root@127.0.0.1:5432/Test",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotCfg, err := ParseURL(tt.dsnURL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(gotCfg, tt.wantCfg) {
+				t.Errorf("ParseURL() = %+v, want %+v", gotCfg, tt.wantCfg)
+			}
+		})
+	}
+}
+
+func TestFormatURLRoundTrip(t *testing.T) {
+	want := NewDSN()
+	want.User = "root"
+	want.Passwd = "pw"
+	want.Addr = "127.0.0.1:3306"
+	want.DBName = "Test"
+	want.TLS = "skip-verify"
+
+	got, err := ParseURL(want.FormatURL())
+	if err != nil {
+		t.Fatalf("ParseURL() error = %v", err)
+	}
+	want.Net = "tcp"
+	want.Addrs = []string{want.Addr}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseDSNMultiAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		dsn     string
+		wantCfg *DSN
+		wantErr bool
+	}{
+		{
+			name:    "single address is backward compatible",
+			dsn:     "root@tcp(127.0.0.1:3306)/Test",
+			wantCfg: withAddrs(DSN{User: "root", Net: "tcp", Addr: "127.0.0.1:3306", DBName: "Test"}),
+		},
+		{
+			name: "multiple failover addresses",
+			dsn:  "root@tcp(10.0.0.1:3306,10.0.0.2:3306,10.0.0.3:3306)/Test",
+			wantCfg: withAddrs(DSN{User: "root", Net: "tcp", Addr: "10.0.0.1:3306", DBName: "Test",
+				Addrs: []string{"10.0.0.1:3306", "10.0.0.2:3306", "10.0.0.3:3306"}}),
+		},
+		{
+			name: "bracketed IPv6 addresses",
+			dsn:  "root@tcp([::1]:3306,[::2]:3306)/Test",
+			wantCfg: withAddrs(DSN{User: "root", Net: "tcp", Addr: "[::1]:3306", DBName: "Test",
+				Addrs: []string{"[::1]:3306", "[::2]:3306"}}),
+		},
+		{
+			name:    "invalid endpoint in the list",
+			dsn:     "root@tcp(10.0.0.1:3306,not-a-host-port)/Test",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotCfg, err := ParseDSN(tt.dsn)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDSN() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(gotCfg, tt.wantCfg) {
+				t.Errorf("ParseDSN() = %+v, want %+v", gotCfg, tt.wantCfg)
+			}
+		})
+	}
+}
+
+func TestFormatDSNMultiAddr(t *testing.T) {
+	cfg := NewDSN()
+	cfg.Net = "tcp"
+	cfg.Addrs = []string{"10.0.0.1:3306", "10.0.0.2:3306"}
+	cfg.Addr = cfg.Addrs[0]
+	cfg.DBName = "Test"
+
+	want := "tcp(10.0.0.1:3306,10.0.0.2:3306)/Test?allowNativePasswords=true&collation=utf8mb4_general_ci&loc=UTC&maxAllowedPacket=4194304"
+	if got := cfg.FormatDSN(); got != want {
+		t.Errorf("FormatDSN() = %v, want %v", got, want)
+	}
+}
+
+func TestTypedOptionsExplicitFalseRoundTrip(t *testing.T) {
+	dsn := "root@/Test?allowNativePasswords=false&multiStatements=false&maxAllowedPacket=0"
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("ParseDSN() error = %v", err)
+	}
+
+	want := withAddrs(DSN{
+		User:                 "root",
+		DBName:               "Test",
+		MaxAllowedPacket:     intPtr(0),
+		AllowNativePasswords: boolPtr(false),
+		MultiStatements:      boolPtr(false),
+	})
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("ParseDSN() = %+v, want %+v", cfg, want)
+	}
+
+	got, err := ParseDSN(cfg.FormatDSN())
+	if err != nil {
+		t.Fatalf("ParseDSN(FormatDSN()) error = %v", err)
+	}
+	if !reflect.DeepEqual(got, cfg) {
+		t.Errorf("round trip = %+v, want %+v", got, cfg)
+	}
+}
+
+func TestFormatURLSpacesRoundTrip(t *testing.T) {
+	cfg := &DSN{
+		User:   "my user",
+		Passwd: "my pw",
+		Net:    "tcp",
+		Addr:   "127.0.0.1:3306",
+		Addrs:  []string{"127.0.0.1:3306"},
+		DBName: "my db",
+	}
+
+	got, err := ParseURL(cfg.FormatURL())
+	if err != nil {
+		t.Fatalf("ParseURL() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, cfg) {
+		t.Errorf("round trip = %+v, want %+v", got, cfg)
+	}
+}
+
+func TestFormatURLMultiAddr(t *testing.T) {
+	cfg := &DSN{
+		User:   "root",
+		Net:    "tcp",
+		Addrs:  []string{"10.0.0.1:3306", "10.0.0.2:3306", "10.0.0.3:3306"},
+		DBName: "Test",
+	}
+	cfg.Addr = cfg.Addrs[0]
+
+	want := "mysql://root@10.0.0.1:3306,10.0.0.2:3306,10.0.0.3:3306/Test"
+	if got := cfg.FormatURL(); got != want {
+		t.Errorf("FormatURL() = %v, want %v", got, want)
+	}
+
+	got, err := ParseURL(want)
+	if err != nil {
+		t.Fatalf("ParseURL() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, cfg) {
+		t.Errorf("round trip = %+v, want %+v", got, cfg)
+	}
+}